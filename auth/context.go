@@ -0,0 +1,45 @@
+package auth
+
+import "context"
+
+type credentialsContextKey struct{}
+
+// WithCredentials returns a copy of ctx carrying mac, picked up by
+// CredentialsFromContext (and so by client.newRequest) to sign requests.
+func WithCredentials(ctx context.Context, mac *Credentials) context.Context {
+	return context.WithValue(ctx, credentialsContextKey{}, mac)
+}
+
+// CredentialsFromContext returns the Credentials previously attached with
+// WithCredentials, if any.
+func CredentialsFromContext(ctx context.Context) (*Credentials, bool) {
+	mac, ok := ctx.Value(credentialsContextKey{}).(*Credentials)
+	return mac, ok
+}
+
+// AuthMode selects which Qiniu request-signing scheme is used for a
+// request: the classic QBox scheme or the newer v2 "Qiniu" scheme
+// required by kodo bucket management v2, CDN and dora processing APIs.
+type AuthMode int
+
+const (
+	// AuthQBox signs with Authorization: QBox <token> (the default).
+	AuthQBox AuthMode = iota
+	// AuthQiniu signs with Authorization: Qiniu <token> (signature v2).
+	AuthQiniu
+)
+
+type authModeContextKey struct{}
+
+// WithAuthMode returns a copy of ctx that requests the given AuthMode for
+// signing, picked up by client.newRequest.
+func WithAuthMode(ctx context.Context, mode AuthMode) context.Context {
+	return context.WithValue(ctx, authModeContextKey{}, mode)
+}
+
+// AuthModeFromContext returns the AuthMode previously attached with
+// WithAuthMode, if any.
+func AuthModeFromContext(ctx context.Context) (AuthMode, bool) {
+	mode, ok := ctx.Value(authModeContextKey{}).(AuthMode)
+	return mode, ok
+}
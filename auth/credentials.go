@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Credentials holds a Qiniu Access Key / Secret Key pair used to sign
+// requests.
+type Credentials struct {
+	AccessKey string
+	SecretKey []byte
+}
+
+// New returns Credentials for the given access and secret key.
+func New(accessKey, secretKey string) *Credentials {
+	return &Credentials{AccessKey: accessKey, SecretKey: []byte(secretKey)}
+}
+
+// Sign signs data and returns "<AccessKey>:<urlsafe-base64 HMAC-SHA1>".
+func (c *Credentials) Sign(data []byte) string {
+	h := hmac.New(sha1.New, c.SecretKey)
+	h.Write(data)
+	return c.AccessKey + ":" + base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// SignWithData signs urlsafe-base64(b) and appends the encoded data,
+// producing the token used by upload policies: "<sign>:<encoded data>".
+func (c *Credentials) SignWithData(b []byte) string {
+	encodedData := base64.URLEncoding.EncodeToString(b)
+	return c.Sign([]byte(encodedData)) + ":" + encodedData
+}
+
+// SignRequest signs req with Qiniu's original (QBox) scheme and returns
+// the "<AccessKey>:<sign>" token for an "Authorization: QBox <token>"
+// header.
+func (c *Credentials) SignRequest(req *http.Request) (token string, err error) {
+	u := req.URL
+	data := u.Path
+	if u.RawQuery != "" {
+		data += "?" + u.RawQuery
+	}
+	data += "\n"
+
+	if req.Body != nil && isSignedBody(req) {
+		body, rerr := peekBody(req)
+		if rerr != nil {
+			return "", rerr
+		}
+		data += string(body)
+	}
+
+	return c.Sign([]byte(data)), nil
+}
+
+// SignRequestV2 signs req with Qiniu's v2 ("Qiniu") scheme, covering the
+// method, host, path, canonical (sorted) query, Content-Type and, for
+// form/JSON bodies, the raw request body. It returns the
+// "<AccessKey>:<sign>" token for an "Authorization: Qiniu <token>"
+// header. A signed body is read without being consumed: through
+// req.GetBody when set, otherwise by buffering it in memory (see peekBody).
+func (c *Credentials) SignRequestV2(req *http.Request) (token string, err error) {
+	var buf bytes.Buffer
+
+	buf.WriteString(req.Method)
+	buf.WriteByte(' ')
+	buf.WriteString(canonicalURI(req.URL))
+	buf.WriteString("\nHost: ")
+	buf.WriteString(requestHost(req))
+
+	ct := req.Header.Get("Content-Type")
+	if ct != "" {
+		buf.WriteString("\nContent-Type: ")
+		buf.WriteString(ct)
+	}
+	buf.WriteString("\n\n")
+
+	if req.Body != nil && isSignedBody(req) {
+		body, rerr := peekBody(req)
+		if rerr != nil {
+			return "", rerr
+		}
+		buf.Write(body)
+	}
+
+	return c.Sign(buf.Bytes()), nil
+}
+
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+func isSignedBody(req *http.Request) bool {
+	ct := req.Header.Get("Content-Type")
+	return strings.HasPrefix(ct, "application/x-www-form-urlencoded") ||
+		strings.HasPrefix(ct, "application/json")
+}
+
+// peekBody returns the request body without consuming it. When GetBody is
+// set, it is used to read an independent copy; otherwise req.Body is read
+// and replaced with an equivalent in-memory reader.
+func peekBody(req *http.Request) ([]byte, error) {
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// canonicalURI returns the request path followed by its query string with
+// keys (and repeated values) sorted, as required by the v2 signature.
+func canonicalURI(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+
+	values := u.Query()
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), values[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return u.Path + "?" + strings.Join(parts, "&")
+}
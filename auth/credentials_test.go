@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalURISortsQueryKeysAndValues(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/path?b=2&a=2&a=1", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	got := canonicalURI(req.URL)
+	want := "/path?a=1&a=2&b=2"
+	if got != want {
+		t.Fatalf("canonicalURI() = %q, want %q", got, want)
+	}
+}
+
+func TestCanonicalURINoQuery(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/path", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	if got, want := canonicalURI(req.URL), "/path"; got != want {
+		t.Fatalf("canonicalURI() = %q, want %q", got, want)
+	}
+}
+
+func TestSignRequestV2MatchesManualCanonicalization(t *testing.T) {
+	c := New("ak", "sk")
+
+	req, err := http.NewRequest(http.MethodPost, "http://upload.qiniup.com/path?b=2&a=1", strings.NewReader(`{"k":"v"}`))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	token, err := c.SignRequestV2(req)
+	if err != nil {
+		t.Fatalf("SignRequestV2: %v", err)
+	}
+
+	want := c.Sign([]byte("POST /path?a=1&b=2\nHost: upload.qiniup.com\nContent-Type: application/json\n\n" + `{"k":"v"}`))
+	if token != want {
+		t.Fatalf("SignRequestV2() = %q, want %q", token, want)
+	}
+}
+
+func TestSignRequestV2OmitsBodyForUnsignedContentType(t *testing.T) {
+	c := New("ak", "sk")
+
+	req, err := http.NewRequest(http.MethodPost, "http://upload.qiniup.com/path", strings.NewReader("raw binary"))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	token, err := c.SignRequestV2(req)
+	if err != nil {
+		t.Fatalf("SignRequestV2: %v", err)
+	}
+
+	want := c.Sign([]byte("POST /path\nHost: upload.qiniup.com\nContent-Type: application/octet-stream\n\n"))
+	if token != want {
+		t.Fatalf("SignRequestV2() = %q, want %q", token, want)
+	}
+}
+
+func TestSignRequestQBoxIncludesFormBody(t *testing.T) {
+	c := New("ak", "sk")
+
+	req, err := http.NewRequest(http.MethodPost, "http://rs.qiniu.com/move/foo", strings.NewReader("a=1"))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	token, err := c.SignRequest(req)
+	if err != nil {
+		t.Fatalf("SignRequest: %v", err)
+	}
+
+	want := c.Sign([]byte("/move/foo\na=1"))
+	if token != want {
+		t.Fatalf("SignRequest() = %q, want %q", token, want)
+	}
+}
@@ -0,0 +1,356 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DefaultChunkSize is the size of each chunk uploaded by a BlobWriter when
+// ChunkSize is left unset.
+const DefaultChunkSize = 4 * 1024 * 1024
+
+// DefaultParallelism is the number of chunks a BlobWriter flushes
+// concurrently when Parallelism is left unset.
+const DefaultParallelism = 4
+
+// blobWriterChunk records the server-assigned context token for one
+// uploaded block, so a BlobWriter can be resumed after a crash. A zero
+// value (empty Ctx) marks a slot whose upload has not completed yet.
+type blobWriterChunk struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Ctx    string `json:"ctx"`
+}
+
+// BlobWriterState is the serializable progress of a BlobWriter, produced
+// by MarshalState and consumed by RestoreBlobWriter.
+type BlobWriterState struct {
+	UpHost    string            `json:"up_host"`
+	ChunkSize int64             `json:"chunk_size"`
+	Chunks    []blobWriterChunk `json:"chunks"`
+	Size      int64             `json:"size"`
+}
+
+// BlobWriter is an io.WriteCloser backed by Qiniu's resumable (mkblk/mkfile)
+// upload protocol. It buffers writes up to ChunkSize and flushes each full
+// chunk to the server as one mkblk block, up to Parallelism at a time. A BlobWriter is not
+// safe for concurrent use by multiple goroutines.
+type BlobWriter struct {
+	Client      Client
+	UpHost      string
+	ChunkSize   int64
+	Parallelism int
+
+	buf       []byte
+	offset    int64 // bytes accepted via Write/ReadFrom so far
+	submitted int64 // bytes handed to flushChunk so far, used as each chunk's Offset
+
+	mu       sync.Mutex
+	chunks   []blobWriterChunk // indexed by submission order, not completion order
+	sem      chan struct{}
+	wg       sync.WaitGroup
+	err      error
+	closed   bool
+	ctx      context.Context
+	cancelFn context.CancelFunc
+}
+
+// NewBlobWriter creates a BlobWriter that uploads to upHost.
+func NewBlobWriter(c Client, upHost string) *BlobWriter {
+	return &BlobWriter{Client: c, UpHost: upHost}
+}
+
+func (w *BlobWriter) chunkSize() int64 {
+	if w.ChunkSize > 0 {
+		return w.ChunkSize
+	}
+	return DefaultChunkSize
+}
+
+func (w *BlobWriter) sema() chan struct{} {
+	if w.sem == nil {
+		n := w.Parallelism
+		if n <= 0 {
+			n = DefaultParallelism
+		}
+		w.sem = make(chan struct{}, n)
+	}
+	return w.sem
+}
+
+// uploadCtxLocked returns the context used for all mkblk/mkfile calls,
+// creating it lazily so Cancel can interrupt in-flight and queued uploads
+// even though no context is passed in until Cancel is called. Callers
+// must hold w.mu.
+func (w *BlobWriter) uploadCtxLocked() context.Context {
+	if w.ctx == nil {
+		w.ctx, w.cancelFn = context.WithCancel(context.Background())
+	}
+	return w.ctx
+}
+
+// Write implements io.Writer, buffering data and flushing full chunks to
+// the server as they fill.
+func (w *BlobWriter) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errBlobWriterClosed
+	}
+
+	n = len(p)
+	w.buf = append(w.buf, p...)
+	w.offset += int64(n)
+
+	for int64(len(w.buf)) >= w.chunkSize() {
+		chunk := w.buf[:w.chunkSize()]
+		w.buf = w.buf[w.chunkSize():]
+		if err = w.flushChunk(chunk); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom implements io.ReaderFrom, reading r in chunkSize pieces and
+// flushing each one as it fills.
+func (w *BlobWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	buf := make([]byte, w.chunkSize())
+	for {
+		nr, rerr := r.Read(buf)
+		if nr > 0 {
+			nw, werr := w.Write(buf[:nr])
+			n += int64(nw)
+			if werr != nil {
+				return n, werr
+			}
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// flushChunk uploads one full-size chunk, blocking until a slot is free
+// among Parallelism concurrent uploads. The chunk's index and offset are
+// fixed at submission time (not completion time), so out-of-order
+// completions still land in the right place in w.chunks.
+func (w *BlobWriter) flushChunk(data []byte) error {
+	w.mu.Lock()
+	if w.err != nil {
+		defer w.mu.Unlock()
+		return w.err
+	}
+
+	idx := len(w.chunks)
+	offset := w.submitted
+	w.submitted += int64(len(data))
+	w.chunks = append(w.chunks, blobWriterChunk{})
+	ctx := w.uploadCtxLocked()
+	w.mu.Unlock()
+
+	sem := w.sema()
+	sem <- struct{}{}
+	w.wg.Add(1)
+	go func() {
+		defer func() { <-sem; w.wg.Done() }()
+		ctxToken, err := w.mkblk(ctx, data)
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if err != nil {
+			if w.err == nil {
+				w.err = err
+			}
+			return
+		}
+		w.chunks[idx] = blobWriterChunk{Offset: offset, Size: int64(len(data)), Ctx: ctxToken}
+	}()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// completedPrefixLocked returns the longest prefix of w.chunks whose
+// uploads have all completed. A chunk still in flight (or one that
+// failed and was never written) leaves a gap; anything after the first
+// gap cannot be resumed safely and is dropped.
+func (w *BlobWriter) completedPrefixLocked() []blobWriterChunk {
+	for i, c := range w.chunks {
+		if c.Ctx == "" {
+			return w.chunks[:i]
+		}
+	}
+	return w.chunks
+}
+
+// mkblk uploads one block via the mkblk API and returns its ctx token.
+func (w *BlobWriter) mkblk(ctx context.Context, data []byte) (ctxToken string, err error) {
+	url := fmt.Sprintf("%s/mkblk/%d", w.UpHost, len(data))
+	var ret struct {
+		Ctx string `json:"ctx"`
+	}
+	err = w.Client.CallWith64(ctx, &ret, "POST", url, nil, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	return ret.Ctx, nil
+}
+
+// Seek implements the subset of io.Seeker needed to report Size(): only
+// Seek(0, io.SeekCurrent) is supported.
+func (w *BlobWriter) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekCurrent {
+		return 0, errBlobWriterSeekUnsupported
+	}
+	return w.Size(), nil
+}
+
+// Size reports the number of bytes accepted by Write/ReadFrom so far,
+// including data still buffered and not yet flushed.
+func (w *BlobWriter) Size() int64 {
+	return w.offset
+}
+
+// Close flushes any remaining buffered bytes, waits for in-flight chunk
+// uploads to finish, and commits the file with mkfile.
+func (w *BlobWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if len(w.buf) > 0 {
+		if err := w.flushChunk(w.buf); err != nil {
+			return err
+		}
+		w.buf = nil
+	}
+
+	w.wg.Wait()
+
+	w.mu.Lock()
+	err := w.err
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	ctx := w.uploadCtxLocked()
+	w.mu.Unlock()
+
+	return w.mkfile(ctx)
+}
+
+func (w *BlobWriter) mkfile(ctx context.Context) error {
+	w.mu.Lock()
+	ctxs := make([]string, len(w.chunks))
+	for i, c := range w.chunks {
+		ctxs[i] = c.Ctx
+	}
+	w.mu.Unlock()
+
+	body := []byte(joinCtx(ctxs))
+	url := fmt.Sprintf("%s/mkfile/%d", w.UpHost, w.Size())
+	var ret struct{}
+	return w.Client.CallWith(ctx, &ret, "POST", url, nil, bytes.NewReader(body), len(body))
+}
+
+func joinCtx(ctxs []string) string {
+	var buf bytes.Buffer
+	for i, c := range ctxs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(c)
+	}
+	return buf.String()
+}
+
+// Cancel stops the upload: queued and future chunk uploads are abandoned
+// immediately, and any chunk uploads already in flight are interrupted by
+// canceling the context they were issued with. It blocks until those
+// in-flight uploads have unwound or ctx is done, whichever comes first.
+// Blocks already accepted by the server are left for Qiniu to
+// garbage-collect.
+func (w *BlobWriter) Cancel(ctx context.Context) error {
+	w.mu.Lock()
+	if w.err == nil {
+		w.err = errBlobWriterCanceled
+	}
+	w.closed = true
+	cancelFn := w.cancelFn
+	w.mu.Unlock()
+
+	if cancelFn != nil {
+		cancelFn()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// MarshalState serializes the writer's progress so an upload can be
+// resumed by a subsequent process via RestoreBlobWriter. Bytes still
+// buffered and not yet flushed, and any chunk upload still in flight (and
+// anything submitted after it), are not captured and must be rewritten
+// by the caller after restoring.
+func (w *BlobWriter) MarshalState() ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	completed := w.completedPrefixLocked()
+	var size int64
+	for _, c := range completed {
+		size += c.Size
+	}
+
+	state := BlobWriterState{
+		UpHost:    w.UpHost,
+		ChunkSize: w.chunkSize(),
+		Chunks:    append([]blobWriterChunk(nil), completed...),
+		Size:      size,
+	}
+	return json.Marshal(state)
+}
+
+// RestoreBlobWriter reconstructs a BlobWriter from state previously
+// produced by MarshalState, positioned to continue from where it left
+// off.
+func RestoreBlobWriter(c Client, state []byte) (*BlobWriter, error) {
+	var s BlobWriterState
+	if err := json.Unmarshal(state, &s); err != nil {
+		return nil, err
+	}
+	return &BlobWriter{
+		Client:    c,
+		UpHost:    s.UpHost,
+		ChunkSize: s.ChunkSize,
+		chunks:    s.Chunks,
+		offset:    s.Size,
+		submitted: s.Size,
+	}, nil
+}
+
+var (
+	errBlobWriterClosed          = errors.New("client: blob writer is closed")
+	errBlobWriterCanceled        = errors.New("client: blob writer was canceled")
+	errBlobWriterSeekUnsupported = errors.New("client: blob writer only supports Seek(0, io.SeekCurrent)")
+)
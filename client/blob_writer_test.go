@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestBlobWriterChunkOrder reproduces a slow first chunk finishing after a
+// fast second chunk: mkfile must still see ctx tokens in submission order,
+// and each chunk must keep the offset it was submitted at.
+func TestBlobWriterChunkOrder(t *testing.T) {
+	var mkfileBody string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mkblk/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) == "AAAA" {
+			time.Sleep(50 * time.Millisecond) // finishes after the second chunk
+		}
+		json.NewEncoder(w).Encode(map[string]string{"ctx": "ctx-for-" + string(body)})
+	})
+	mux.HandleFunc("/mkfile/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mkfileBody = string(body)
+		w.Write([]byte("{}"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	bw := NewBlobWriter(Client{Client: &http.Client{}}, srv.URL)
+	bw.ChunkSize = 4
+	bw.Parallelism = 2
+
+	if _, err := bw.Write([]byte("AAAA")); err != nil {
+		t.Fatalf("Write #1: %v", err)
+	}
+	if _, err := bw.Write([]byte("BBBB")); err != nil {
+		t.Fatalf("Write #2: %v", err)
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if want := "ctx-for-AAAA,ctx-for-BBBB"; mkfileBody != want {
+		t.Fatalf("mkfile body = %q, want %q", mkfileBody, want)
+	}
+
+	if len(bw.chunks) != 2 {
+		t.Fatalf("len(chunks) = %d, want 2", len(bw.chunks))
+	}
+	if bw.chunks[0].Offset != 0 {
+		t.Errorf("chunks[0].Offset = %d, want 0", bw.chunks[0].Offset)
+	}
+	if bw.chunks[1].Offset != 4 {
+		t.Errorf("chunks[1].Offset = %d, want 4", bw.chunks[1].Offset)
+	}
+}
+
+// blockingRoundTripper signals via started that a request arrived, then
+// blocks until that context is done, so tests can deterministically
+// observe an in-flight HTTP call without depending on OS-level connection
+// teardown timing.
+type blockingRoundTripper struct {
+	started chan struct{}
+}
+
+func (t *blockingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	close(t.started)
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+// TestBlobWriterCancelInterruptsInFlight verifies Cancel cancels the
+// context used by an in-flight chunk upload and waits for it to unwind
+// before returning.
+func TestBlobWriterCancelInterruptsInFlight(t *testing.T) {
+	rt := &blockingRoundTripper{started: make(chan struct{})}
+	bw := NewBlobWriter(Client{Client: &http.Client{Transport: rt}}, "http://example.invalid")
+	bw.ChunkSize = 4
+
+	go bw.Write([]byte("AAAA"))
+
+	select {
+	case <-rt.started:
+	case <-time.After(time.Second):
+		t.Fatal("mkblk was never called")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := bw.Cancel(ctx); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+}
+
+// TestBlobWriterMarshalStateSkipsIncompleteTail verifies that an
+// in-flight (never-completed) chunk, and anything submitted after it, is
+// dropped from MarshalState rather than corrupting the resumed offset.
+func TestBlobWriterMarshalStateSkipsIncompleteTail(t *testing.T) {
+	bw := NewBlobWriter(Client{Client: &http.Client{}}, "http://example.invalid")
+	bw.chunks = []blobWriterChunk{
+		{Offset: 0, Size: 4, Ctx: "ctx-0"},
+		{Offset: 4, Size: 4, Ctx: ""}, // still in flight
+		{Offset: 8, Size: 4, Ctx: "ctx-2"},
+	}
+
+	data, err := bw.MarshalState()
+	if err != nil {
+		t.Fatalf("MarshalState: %v", err)
+	}
+
+	var s BlobWriterState
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(s.Chunks) != 1 || s.Chunks[0].Ctx != "ctx-0" {
+		t.Fatalf("Chunks = %+v, want only the completed leading chunk", s.Chunks)
+	}
+	if s.Size != 4 {
+		t.Fatalf("Size = %d, want 4", s.Size)
+	}
+
+	restored, err := RestoreBlobWriter(Client{Client: &http.Client{}}, data)
+	if err != nil {
+		t.Fatalf("RestoreBlobWriter: %v", err)
+	}
+	if restored.Size() != 4 {
+		t.Fatalf("restored.Size() = %d, want 4", restored.Size())
+	}
+}
@@ -11,19 +11,49 @@ import (
 	"net/url"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/Aoang/qiniu.api.v7/auth"
 	"github.com/Aoang/qiniu.api.v7/conf"
 	"github.com/Aoang/qiniu.api.v7/reqid"
 )
 
+// AuthMode selects which Qiniu request-signing scheme newRequest uses; see
+// auth.AuthMode. Set it per-request with auth.WithAuthMode(ctx, mode).
+type AuthMode = auth.AuthMode
+
+const (
+	AuthQBox  = auth.AuthQBox
+	AuthQiniu = auth.AuthQiniu
+)
+
 var UserAgent = "Golang qiniu/client package"
-var DefaultClient = Client{&http.Client{Transport: http.DefaultTransport}}
+var DefaultClient = Client{Client: &http.Client{Transport: NewRetryTransport(http.DefaultTransport, RetryOptions{})}}
 
 // --------------------------------------------------------------------
 
 type Client struct {
 	*http.Client
+
+	mws []Middleware
+}
+
+// Handler performs a single HTTP round trip. It is the type threaded
+// through a Client's middleware chain.
+type Handler func(ctx context.Context, req *http.Request) (*http.Response, error)
+
+// Middleware wraps a Handler to add cross-cutting behavior (logging,
+// metrics, retries, tracing, ...) around request execution.
+type Middleware func(next Handler) Handler
+
+// Use appends mw to the chain of middlewares that Do runs every request
+// through. Middlewares run in the order they are added, wrapping the
+// client's default behavior (X-Reqid/User-Agent/cancellation), which
+// always remains innermost. Request signing (QBox or Qiniu) is not part
+// of the chain: newRequest signs the request before Do is called, so
+// middlewares see an already-signed request.
+func (r *Client) Use(mw ...Middleware) {
+	r.mws = append(r.mws, mw...)
 }
 
 // userApp should be [A-Za-z0-9_\ \-\.]*
@@ -36,7 +66,11 @@ func SetAppName(userApp string) error {
 // --------------------------------------------------------------------
 
 func newRequest(ctx context.Context, method, reqUrl string, headers http.Header, body io.Reader) (req *http.Request, err error) {
-	req, err = http.NewRequest(method, reqUrl, body)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	req, err = http.NewRequestWithContext(ctx, method, reqUrl, body)
 	if err != nil {
 		return
 	}
@@ -49,14 +83,26 @@ func newRequest(ctx context.Context, method, reqUrl string, headers http.Header,
 
 	//check access token
 	mac, ok := auth.CredentialsFromContext(ctx)
-	if ok {
-		token, signErr := mac.SignRequest(req)
+	if !ok {
+		return
+	}
+
+	if mode, _ := auth.AuthModeFromContext(ctx); mode == AuthQiniu {
+		token, signErr := mac.SignRequestV2(req)
 		if signErr != nil {
 			err = signErr
 			return
 		}
-		req.Header.Add("Authorization", "QBox "+token)
+		req.Header.Add("Authorization", "Qiniu "+token)
+		return
+	}
+
+	token, signErr := mac.SignRequest(req)
+	if signErr != nil {
+		err = signErr
+		return
 	}
+	req.Header.Add("Authorization", "QBox "+token)
 
 	return
 }
@@ -133,45 +179,62 @@ func (r Client) Do(ctx context.Context, req *http.Request) (resp *http.Response,
 		ctx = context.Background()
 	}
 
-	if reqId, ok := reqid.ReqidFromContext(ctx); ok {
-		req.Header.Set("X-Reqid", reqId)
-	}
+	h := r.chain()
+	return h(ctx, req)
+}
 
-	if _, ok := req.Header["User-Agent"]; !ok {
-		req.Header.Set("User-Agent", UserAgent)
+// chain assembles the handler that Do invokes: the caller's middlewares,
+// added via Use, wrapped around the client's default innermost
+// middlewares (X-Reqid, User-Agent, cancellation) and the underlying
+// transport call.
+func (r Client) chain() Handler {
+	h := r.transportHandler
+	h = cancelMiddleware(h)
+	h = userAgentMiddleware(h)
+	h = requestIDMiddleware(h)
+	for i := len(r.mws) - 1; i >= 0; i-- {
+		h = r.mws[i](h)
 	}
+	return h
+}
 
-	transport := r.Transport // don't change r.Transport
-	if transport == nil {
-		transport = http.DefaultTransport
+func requestIDMiddleware(next Handler) Handler {
+	return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		if reqId, ok := reqid.ReqidFromContext(ctx); ok {
+			req.Header.Set("X-Reqid", reqId)
+		}
+		return next(ctx, req)
 	}
+}
 
-	// avoid cancel() is called before Do(req), but isn't accurate
-	select {
-	case <-ctx.Done():
-		err = ctx.Err()
-		return
-	default:
+func userAgentMiddleware(next Handler) Handler {
+	return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		if _, ok := req.Header["User-Agent"]; !ok {
+			req.Header.Set("User-Agent", UserAgent)
+		}
+		return next(ctx, req)
 	}
+}
+
+// cancelMiddleware aborts before issuing a request whose context is
+// already done. In-flight cancellation is handled natively by req's
+// context, attached in newRequest via http.NewRequestWithContext.
+func cancelMiddleware(next Handler) Handler {
+	return func(ctx context.Context, req *http.Request) (resp *http.Response, err error) {
 
-	if tr, ok := getRequestCanceler(transport); ok {
-		// support CancelRequest
-		reqC := make(chan bool, 1)
-		go func() {
-			resp, err = r.Client.Do(req)
-			reqC <- true
-		}()
+		// avoid cancel() is called before Do(req), but isn't accurate
 		select {
-		case <-reqC:
 		case <-ctx.Done():
-			tr.CancelRequest(req)
-			<-reqC
-			err = ctx.Err()
+			return nil, ctx.Err()
+		default:
 		}
-	} else {
-		resp, err = r.Client.Do(req)
+
+		return next(ctx, req)
 	}
-	return
+}
+
+func (r Client) transportHandler(_ context.Context, req *http.Request) (resp *http.Response, err error) {
+	return r.Client.Do(req)
 }
 
 // --------------------------------------------------------------------
@@ -182,6 +245,11 @@ type ErrorInfo struct {
 	Reqid string `json:"reqid,omitempty"`
 	Errno int    `json:"errno,omitempty"`
 	Code  int    `json:"code"`
+
+	// retryAfter is the delay requested by a 429/503 response's
+	// Retry-After header, if any. Surfaced via errors.As into a
+	// RateLimitedError; see ErrorInfo's As method in errors.go.
+	retryAfter time.Duration
 }
 
 func (r *ErrorInfo) ErrorDetail() string {
@@ -228,11 +296,18 @@ func parseError(e *ErrorInfo, r io.Reader) {
 	e.Err = string(body)
 }
 
+// ResponseError always returns a bare *ErrorInfo — existing code doing
+// err.(*client.ErrorInfo) keeps matching exactly as before. Callers that
+// want to classify the error by status code/errno should use
+// errors.Is/errors.As against the sentinels and types in errors.go
+// instead, which ErrorInfo's own Is/As methods support without changing
+// its dynamic type.
 func ResponseError(resp *http.Response) (err error) {
 
 	e := &ErrorInfo{
-		Reqid: resp.Header.Get("X-Reqid"),
-		Code:  resp.StatusCode,
+		Reqid:      resp.Header.Get("X-Reqid"),
+		Code:       resp.StatusCode,
+		retryAfter: retryAfterDelay(resp),
 	}
 	if resp.StatusCode > 299 {
 		if resp.ContentLength != 0 {
@@ -317,31 +392,16 @@ func (r Client) Call(ctx context.Context, ret interface{}, method, reqUrl string
 
 // ---------------------------------------------------------------------------
 
+// Deprecated: transportHandler now relies on http.NewRequestWithContext
+// for cancellation; these interfaces are unused and will be removed in a
+// future release.
 type requestCanceler interface {
 	CancelRequest(req *http.Request)
 }
 
+// Deprecated: see requestCanceler.
 type nestedObjectGetter interface {
 	NestedObject() interface{}
 }
 
-func getRequestCanceler(tp http.RoundTripper) (rc requestCanceler, ok bool) {
-
-	if rc, ok = tp.(requestCanceler); ok {
-		return
-	}
-
-	p := interface{}(tp)
-	for {
-		getter, ok1 := p.(nestedObjectGetter)
-		if !ok1 {
-			return
-		}
-		p = getter.NestedObject()
-		if rc, ok = p.(requestCanceler); ok {
-			return
-		}
-	}
-}
-
 // --------------------------------------------------------------------
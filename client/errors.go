@@ -0,0 +1,166 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// The following types classify an *ErrorInfo by HTTP status code (or,
+// where Qiniu uses its own errno, by that errno) so callers can use
+// errors.Is/errors.As instead of switching on HttpCode() or matching Err
+// strings. ResponseError always returns a bare *ErrorInfo — these types
+// are never the error's dynamic type — so existing code doing
+// err.(*client.ErrorInfo) keeps compiling and matching exactly as
+// before; *ErrorInfo's own Is/As methods below synthesize one of these
+// on demand for errors.Is/errors.As callers instead.
+
+// UnauthorizedError wraps *ErrorInfo for HTTP 401 responses.
+type UnauthorizedError struct{ *ErrorInfo }
+
+// ForbiddenError wraps *ErrorInfo for HTTP 403 responses.
+type ForbiddenError struct{ *ErrorInfo }
+
+// NotFoundError wraps *ErrorInfo for HTTP 404 responses, and for
+// errno=612 ("no such file or directory") on any status code.
+type NotFoundError struct{ *ErrorInfo }
+
+// ConflictError wraps *ErrorInfo for HTTP 409 responses.
+type ConflictError struct{ *ErrorInfo }
+
+// RateLimitedError wraps *ErrorInfo for HTTP 429 and 573 (Qiniu's "too
+// many requests") responses, carrying the delay requested by the
+// server's Retry-After header, if any.
+type RateLimitedError struct {
+	*ErrorInfo
+	RetryAfter time.Duration
+}
+
+// ServerBusyError wraps *ErrorInfo for HTTP 503 responses.
+type ServerBusyError struct{ *ErrorInfo }
+
+// BadRequestError wraps *ErrorInfo for HTTP 400 responses.
+type BadRequestError struct{ *ErrorInfo }
+
+// Sentinel values for use with errors.Is, e.g.
+// errors.Is(err, client.ErrNotFound).
+var (
+	ErrUnauthorized error = &UnauthorizedError{}
+	ErrForbidden    error = &ForbiddenError{}
+	ErrNotFound     error = &NotFoundError{}
+	ErrConflict     error = &ConflictError{}
+	ErrRateLimited  error = &RateLimitedError{}
+	ErrServerBusy   error = &ServerBusyError{}
+	ErrBadRequest   error = &BadRequestError{}
+)
+
+// classification reports which typed error, if any, matches e.
+func (e *ErrorInfo) classification() (kind string) {
+	switch {
+	case e.Errno == 612:
+		return "NotFound"
+	case e.Code == http.StatusUnauthorized:
+		return "Unauthorized"
+	case e.Code == http.StatusForbidden:
+		return "Forbidden"
+	case e.Code == http.StatusNotFound:
+		return "NotFound"
+	case e.Code == http.StatusConflict:
+		return "Conflict"
+	case e.Code == http.StatusTooManyRequests, e.Code == 573:
+		return "RateLimited"
+	case e.Code == http.StatusServiceUnavailable:
+		return "ServerBusy"
+	case e.Code == http.StatusBadRequest:
+		return "BadRequest"
+	}
+	return ""
+}
+
+// Is reports whether target is one of the typed errors in this file whose
+// status code or errno matches e, so errors.Is(err, client.ErrNotFound)
+// works even though ResponseError never actually wraps e in a
+// *NotFoundError.
+func (e *ErrorInfo) Is(target error) bool {
+	switch target.(type) {
+	case *UnauthorizedError:
+		return e.classification() == "Unauthorized"
+	case *ForbiddenError:
+		return e.classification() == "Forbidden"
+	case *NotFoundError:
+		return e.classification() == "NotFound"
+	case *ConflictError:
+		return e.classification() == "Conflict"
+	case *RateLimitedError:
+		return e.classification() == "RateLimited"
+	case *ServerBusyError:
+		return e.classification() == "ServerBusy"
+	case *BadRequestError:
+		return e.classification() == "BadRequest"
+	}
+	return false
+}
+
+// As fills target, a pointer to one of the typed errors in this file,
+// with a wrapper around e if its kind matches e's classification — the
+// errors.As counterpart to Is, used by callers who want the wrapper
+// itself (e.g. RateLimitedError.RetryAfter) rather than a bool.
+func (e *ErrorInfo) As(target interface{}) bool {
+	switch t := target.(type) {
+	case **UnauthorizedError:
+		if e.classification() != "Unauthorized" {
+			return false
+		}
+		*t = &UnauthorizedError{e}
+	case **ForbiddenError:
+		if e.classification() != "Forbidden" {
+			return false
+		}
+		*t = &ForbiddenError{e}
+	case **NotFoundError:
+		if e.classification() != "NotFound" {
+			return false
+		}
+		*t = &NotFoundError{e}
+	case **ConflictError:
+		if e.classification() != "Conflict" {
+			return false
+		}
+		*t = &ConflictError{e}
+	case **RateLimitedError:
+		if e.classification() != "RateLimited" {
+			return false
+		}
+		*t = &RateLimitedError{ErrorInfo: e, RetryAfter: e.retryAfter}
+	case **ServerBusyError:
+		if e.classification() != "ServerBusy" {
+			return false
+		}
+		*t = &ServerBusyError{e}
+	case **BadRequestError:
+		if e.classification() != "BadRequest" {
+			return false
+		}
+		*t = &BadRequestError{e}
+	default:
+		return false
+	}
+	return true
+}
+
+// IsRetryable reports whether err represents a transient failure that is
+// safe to retry: rate limiting, server-busy, one of the 5xx statuses the
+// retry transport itself retries on, or one of the network errors it
+// retries on (timeouts, unexpected EOF, connection resets). It applies
+// the same rules as NewRetryTransport, so application code and the
+// transport agree on what is "retryable".
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var ei *ErrorInfo
+	if errors.As(err, &ei) {
+		return IsRetryableStatus(ei.Code)
+	}
+	return shouldRetry(nil, err)
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newResponse(status int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Header:        header,
+		Body:          http.NoBody,
+		ContentLength: int64(len(body)),
+	}
+}
+
+func TestResponseErrorDynamicTypeStaysErrorInfo(t *testing.T) {
+	resp := newResponse(http.StatusNotFound, nil, "")
+	err := ResponseError(resp)
+
+	if _, ok := err.(*ErrorInfo); !ok {
+		t.Fatalf("ResponseError's dynamic type = %T, want *ErrorInfo", err)
+	}
+}
+
+func TestResponseErrorMatchesErrorsIs(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		target error
+	}{
+		{"Unauthorized", http.StatusUnauthorized, ErrUnauthorized},
+		{"Forbidden", http.StatusForbidden, ErrForbidden},
+		{"NotFound", http.StatusNotFound, ErrNotFound},
+		{"Conflict", http.StatusConflict, ErrConflict},
+		{"RateLimited", http.StatusTooManyRequests, ErrRateLimited},
+		{"RateLimited573", 573, ErrRateLimited},
+		{"ServerBusy", http.StatusServiceUnavailable, ErrServerBusy},
+		{"BadRequest", http.StatusBadRequest, ErrBadRequest},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ResponseError(newResponse(c.status, nil, ""))
+			if !errors.Is(err, c.target) {
+				t.Fatalf("errors.Is(err, %s) = false, want true", c.name)
+			}
+		})
+	}
+}
+
+func TestResponseErrorErrno612MatchesNotFoundOnAnyStatus(t *testing.T) {
+	body := `{"error":"no such file or directory","errno":612}`
+	resp := &http.Response{
+		StatusCode:    499, // arbitrary non-404 status; classification goes by errno here
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          nopBody(body),
+		ContentLength: int64(len(body)),
+	}
+
+	err := ResponseError(resp)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("errors.Is(err, ErrNotFound) = false for errno=612, want true")
+	}
+}
+
+func TestResponseErrorAsRateLimitedCarriesRetryAfter(t *testing.T) {
+	resp := newResponse(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"2"}}, "")
+	err := ResponseError(resp)
+
+	var rle *RateLimitedError
+	if !errors.As(err, &rle) {
+		t.Fatalf("errors.As(err, &rle) = false, want true")
+	}
+	if rle.RetryAfter != 2*time.Second {
+		t.Fatalf("RetryAfter = %v, want 2s", rle.RetryAfter)
+	}
+}
+
+func TestResponseErrorDoesNotMatchUnrelatedKind(t *testing.T) {
+	err := ResponseError(newResponse(http.StatusNotFound, nil, ""))
+	if errors.Is(err, ErrForbidden) {
+		t.Fatalf("errors.Is(err, ErrForbidden) = true for a 404, want false")
+	}
+	var ue *UnauthorizedError
+	if errors.As(err, &ue) {
+		t.Fatalf("errors.As(err, &ue) = true for a 404, want false")
+	}
+}
+
+func nopBody(s string) *nopReadCloser {
+	return &nopReadCloser{Reader: strings.NewReader(s)}
+}
+
+type nopReadCloser struct{ *strings.Reader }
+
+func (nopReadCloser) Close() error { return nil }
@@ -0,0 +1,249 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryOptions controls the behavior of the transport returned by
+// NewRetryTransport.
+type RetryOptions struct {
+	// MaxAttempts is the total number of times a request may be issued,
+	// including the first, non-retried attempt. Defaults to 3.
+	MaxAttempts int
+
+	// BaseDelay is the initial backoff delay. Defaults to 100ms.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the backoff delay. Defaults to 10s.
+	MaxDelay time.Duration
+
+	// OnRetry, if set, is called before each retry attempt with the
+	// attempt number (1-based), the error that triggered the retry (nil
+	// if triggered by a retryable status code) and the response that was
+	// received, if any.
+	OnRetry func(attempt int, err error, resp *http.Response)
+}
+
+func (o *RetryOptions) maxAttempts() int {
+	if o.MaxAttempts > 0 {
+		return o.MaxAttempts
+	}
+	return 3
+}
+
+func (o *RetryOptions) baseDelay() time.Duration {
+	if o.BaseDelay > 0 {
+		return o.BaseDelay
+	}
+	return 100 * time.Millisecond
+}
+
+func (o *RetryOptions) maxDelay() time.Duration {
+	if o.MaxDelay > 0 {
+		return o.MaxDelay
+	}
+	return 10 * time.Second
+}
+
+// retryTransport is an http.RoundTripper that retries idempotent requests
+// that fail with a transient error, using decorrelated-jitter exponential
+// backoff.
+type retryTransport struct {
+	base http.RoundTripper
+	opts RetryOptions
+}
+
+// NewRetryTransport wraps base with retry logic for transient failures:
+// network timeouts, unexpected EOFs, connection resets, and 429, 500,
+// 502, 503, 504 and 573 responses (see IsRetryableStatus). base
+// defaults to http.DefaultTransport when nil.
+func NewRetryTransport(base http.RoundTripper, opts RetryOptions) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{base: base, opts: opts}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+
+	if !IsIdempotentRequest(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	attempts := t.opts.maxAttempts()
+	prevDelay := t.opts.baseDelay()
+
+	for attempt := 1; ; attempt++ {
+
+		if attempt > 1 {
+			if req.Body != nil {
+				body, rewindErr := RewindRequestBody(req)
+				if rewindErr != nil {
+					return resp, err
+				}
+				req.Body = body
+			}
+		}
+
+		resp, err = t.base.RoundTrip(req)
+
+		if attempt >= attempts || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		delay := retryAfterDelay(resp)
+		if delay == 0 {
+			delay = DecorrelatedJitter(prevDelay, t.opts.baseDelay(), t.opts.maxDelay())
+		}
+		prevDelay = delay
+
+		if t.opts.OnRetry != nil {
+			t.opts.OnRetry(attempt, err, resp)
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// IsIdempotentRequest reports whether req is safe to retry: GET/HEAD
+// always qualify, PUT qualifies only when its body can be rewound via
+// GetBody (or there is none). POST is never considered idempotent, since
+// unlike PUT it is not defined to be safe to resend even when its body
+// can be rewound. It is exported so other middlewares that retry at the
+// Handler level instead of the transport level (e.g. clientmw.Retry) can
+// apply the same idempotency rule.
+func IsIdempotentRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPut:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+// RewindRequestBody returns a fresh copy of req.Body using req.GetBody.
+// It refuses to retry a request whose body is a non-seekable reader that
+// may already have bytes consumed.
+func RewindRequestBody(req *http.Request) (io.ReadCloser, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req.Body, nil
+	}
+	if req.GetBody == nil {
+		return nil, errNonSeekableBody
+	}
+	return req.GetBody()
+}
+
+var errNonSeekableBody = &ErrorInfo{Err: "client: request body is not seekable, cannot retry"}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return true
+		}
+		if err == io.ErrUnexpectedEOF {
+			return true
+		}
+		if isConnResetErr(err) {
+			return true
+		}
+		return false
+	}
+
+	return IsRetryableStatus(resp.StatusCode)
+}
+
+func isConnResetErr(err error) bool {
+	var opErr *net.OpError
+	for {
+		if oe, ok := err.(*net.OpError); ok {
+			opErr = oe
+			break
+		}
+		type unwrapper interface{ Unwrap() error }
+		u, ok := err.(unwrapper)
+		if !ok {
+			return false
+		}
+		err = u.Unwrap()
+		if err == nil {
+			return false
+		}
+	}
+	return opErr != nil && errors.Is(opErr.Err, syscall.ECONNRESET)
+}
+
+// IsRetryableStatus reports whether code is one of the transient
+// statuses the retry transport retries on; client.IsRetryable checks the
+// same set against an already-parsed *ErrorInfo, and clientmw.Retry
+// reuses it to stay in sync with the transport-level policy.
+func IsRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, 573:
+		return true
+	}
+	return false
+}
+
+// retryAfterDelay honors a Retry-After header (delta-seconds or HTTP-date)
+// on 429/503 responses, returning 0 when absent.
+func retryAfterDelay(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// DecorrelatedJitter implements the "decorrelated jitter" backoff from
+// https://www.awsarchitectureblog.com/2015/03/backoff.html:
+// sleep = min(cap, rand(base, prev*3)). It is exported so other
+// middlewares (e.g. clientmw.Retry) that retry at the Handler level
+// instead of the transport level can share the same backoff policy.
+func DecorrelatedJitter(prev, base, cap time.Duration) time.Duration {
+	upper := prev * 3
+	if upper <= base {
+		upper = base + 1
+	}
+	d := base + time.Duration(rand.Int63n(int64(upper-base)))
+	if d > cap {
+		d = cap
+	}
+	return d
+}
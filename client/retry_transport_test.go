@@ -0,0 +1,151 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterDelaySeconds(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": []string{"2"}},
+	}
+	if got, want := retryAfterDelay(resp), 2*time.Second; got != want {
+		t.Fatalf("retryAfterDelay() = %v, want %v", got, want)
+	}
+}
+
+func TestRetryAfterDelayHTTPDate(t *testing.T) {
+	future := time.Now().Add(3 * time.Second).UTC()
+	resp := &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Retry-After": []string{future.Format(http.TimeFormat)}},
+	}
+	delay := retryAfterDelay(resp)
+	if delay <= 0 || delay > 3*time.Second {
+		t.Fatalf("retryAfterDelay() = %v, want roughly up to 3s", delay)
+	}
+}
+
+func TestRetryAfterDelayIgnoredOutsideRetryableStatus(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Retry-After": []string{"5"}},
+	}
+	if got := retryAfterDelay(resp); got != 0 {
+		t.Fatalf("retryAfterDelay() = %v, want 0 for a 200 response", got)
+	}
+}
+
+func TestDecorrelatedJitterBounds(t *testing.T) {
+	base := 100 * time.Millisecond
+	cap := 10 * time.Second
+	prev := base
+	for i := 0; i < 100; i++ {
+		d := DecorrelatedJitter(prev, base, cap)
+		if d < base || d > cap {
+			t.Fatalf("DecorrelatedJitter() = %v, want in [%v, %v]", d, base, cap)
+		}
+		prev = d
+	}
+}
+
+func TestDecorrelatedJitterCapsAtCap(t *testing.T) {
+	base := 100 * time.Millisecond
+	cap := 200 * time.Millisecond
+	for i := 0; i < 100; i++ {
+		if d := DecorrelatedJitter(cap*10, base, cap); d > cap {
+			t.Fatalf("DecorrelatedJitter() = %v, want <= cap %v", d, cap)
+		}
+	}
+}
+
+// countingTransport fails the first failCount requests with the given
+// status code, then succeeds.
+type countingTransport struct {
+	failCount  int
+	failStatus int
+	calls      int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	if t.calls <= t.failCount {
+		return &http.Response{
+			StatusCode: t.failStatus,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			Header:     http.Header{},
+		}, nil
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Header:     http.Header{},
+	}, nil
+}
+
+func TestRetryTransportRetriesIdempotentRequest(t *testing.T) {
+	base := &countingTransport{failCount: 2, failStatus: http.StatusServiceUnavailable}
+	rt := NewRetryTransport(base, RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+
+	req, err := http.NewRequest(http.MethodGet, "http://example.invalid", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("StatusCode = %d, want 200", resp.StatusCode)
+	}
+	if base.calls != 3 {
+		t.Fatalf("calls = %d, want 3 (2 failures + 1 success)", base.calls)
+	}
+}
+
+func TestRetryTransportGivesUpAfterMaxAttempts(t *testing.T) {
+	base := &countingTransport{failCount: 10, failStatus: http.StatusServiceUnavailable}
+	rt := NewRetryTransport(base, RetryOptions{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+
+	req, err := http.NewRequest(http.MethodGet, "http://example.invalid", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("StatusCode = %d, want 503", resp.StatusCode)
+	}
+	if base.calls != 2 {
+		t.Fatalf("calls = %d, want 2 (MaxAttempts)", base.calls)
+	}
+}
+
+func TestRetryTransportDoesNotRetryNonIdempotentRequest(t *testing.T) {
+	base := &countingTransport{failCount: 10, failStatus: http.StatusServiceUnavailable}
+	rt := NewRetryTransport(base, RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+
+	req, err := http.NewRequest(http.MethodPost, "http://example.invalid", strings.NewReader("body"))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("StatusCode = %d, want 503", resp.StatusCode)
+	}
+	if base.calls != 1 {
+		t.Fatalf("calls = %d, want 1 (POST is not retried)", base.calls)
+	}
+}
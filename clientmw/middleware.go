@@ -0,0 +1,212 @@
+// Package clientmw provides stock client.Middleware implementations for
+// cross-cutting concerns (logging, metrics, retries, circuit breaking,
+// rate limiting, tracing) that applications can install with
+// client.Client.Use without forking the module.
+package clientmw
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Aoang/qiniu.api.v7/client"
+)
+
+// Logger is the subset of log.Logger that Logging needs. *log.Logger
+// satisfies it.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Logging returns a middleware that logs the method, URL, status code (or
+// error) and latency of every request.
+func Logging(logger Logger) client.Middleware {
+	return func(next client.Handler) client.Handler {
+		return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(ctx, req)
+			elapsed := time.Since(start)
+			if err != nil {
+				logger.Printf("client: %s %s failed after %s: %v", req.Method, req.URL, elapsed, err)
+			} else {
+				logger.Printf("client: %s %s -> %d (%s)", req.Method, req.URL, resp.StatusCode, elapsed)
+			}
+			return resp, err
+		}
+	}
+}
+
+// MetricsRecorder receives one observation per request. It is satisfied
+// by a thin adapter over a prometheus.HistogramVec, statsd client, etc.
+type MetricsRecorder interface {
+	ObserveRequest(method string, statusCode int, duration time.Duration)
+}
+
+// Metrics returns a middleware that reports request latency and status
+// to recorder.
+func Metrics(recorder MetricsRecorder) client.Middleware {
+	return func(next client.Handler) client.Handler {
+		return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(ctx, req)
+			status := 0
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			recorder.ObserveRequest(req.Method, status, time.Since(start))
+			return resp, err
+		}
+	}
+}
+
+// Retry returns a middleware that retries a request according to opts,
+// using the same decorrelated-jitter backoff, retryable-status and
+// idempotency/body-rewind rules as client.NewRetryTransport. A
+// non-idempotent request (e.g. a POST, or a PUT with a body that can't
+// be rewound via GetBody) is passed through unretried, since resending it
+// could double-submit it. Prefer wrapping the transport with
+// client.NewRetryTransport instead when possible; this middleware exists
+// for callers who compose behavior at the Handler level (e.g. to retry
+// across a Tracing span).
+func Retry(opts client.RetryOptions) client.Middleware {
+	return func(next client.Handler) client.Handler {
+		return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+			if !client.IsIdempotentRequest(req) {
+				return next(ctx, req)
+			}
+
+			attempts := opts.MaxAttempts
+			if attempts <= 0 {
+				attempts = 3
+			}
+			base := opts.BaseDelay
+			if base <= 0 {
+				base = 100 * time.Millisecond
+			}
+			cap := opts.MaxDelay
+			if cap <= 0 {
+				cap = 10 * time.Second
+			}
+
+			prevDelay := base
+			var resp *http.Response
+			var err error
+			for attempt := 1; ; attempt++ {
+				if attempt > 1 && req.Body != nil {
+					body, rewindErr := client.RewindRequestBody(req)
+					if rewindErr != nil {
+						return resp, err
+					}
+					req.Body = body
+				}
+
+				resp, err = next(ctx, req)
+
+				retryable := err == nil && resp != nil && client.IsRetryableStatus(resp.StatusCode)
+				if attempt >= attempts || !retryable {
+					return resp, err
+				}
+
+				if opts.OnRetry != nil {
+					opts.OnRetry(attempt, err, resp)
+				}
+
+				delay := client.DecorrelatedJitter(prevDelay, base, cap)
+				prevDelay = delay
+
+				timer := time.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
+
+// ErrCircuitOpen is returned by CircuitBreaker while the breaker is open.
+var ErrCircuitOpen = errors.New("clientmw: circuit breaker is open")
+
+// CircuitBreaker returns a middleware that stops issuing requests once
+// failureThreshold consecutive failures (errors or 5xx responses) have
+// been observed, failing fast for cooldown before allowing a trial
+// request through again.
+func CircuitBreaker(failureThreshold int, cooldown time.Duration) client.Middleware {
+	var (
+		mu       sync.Mutex
+		failures int
+		openedAt time.Time
+	)
+
+	return func(next client.Handler) client.Handler {
+		return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			open := failures >= failureThreshold && time.Since(openedAt) < cooldown
+			mu.Unlock()
+			if open {
+				return nil, ErrCircuitOpen
+			}
+
+			resp, err := next(ctx, req)
+
+			mu.Lock()
+			if err != nil || (resp != nil && resp.StatusCode >= 500) {
+				failures++
+				openedAt = time.Now()
+			} else {
+				failures = 0
+			}
+			mu.Unlock()
+
+			return resp, err
+		}
+	}
+}
+
+// RateLimit returns a middleware that admits at most rps requests per
+// second, blocking until a slot is available or ctx is done.
+func RateLimit(rps float64) client.Middleware {
+	interval := time.Duration(float64(time.Second) / rps)
+	limiter := time.NewTicker(interval)
+
+	return func(next client.Handler) client.Handler {
+		return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+			select {
+			case <-limiter.C:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// Tracer starts a span for an outgoing request. It is satisfied by a thin
+// adapter over an otel.Tracer.
+type Tracer interface {
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// Span is the subset of trace.Span that Tracing needs.
+type Span interface {
+	SetStatus(err error)
+	End()
+}
+
+// Tracing returns a middleware that starts a span named "<method> <path>"
+// around each request and records the resulting error, if any.
+func Tracing(tracer Tracer) client.Middleware {
+	return func(next client.Handler) client.Handler {
+		return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+			ctx, span := tracer.Start(ctx, req.Method+" "+req.URL.Path)
+			resp, err := next(ctx, req)
+			span.SetStatus(err)
+			span.End()
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package clientmw
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Aoang/qiniu.api.v7/client"
+)
+
+func TestRetryRetriesIdempotentGet(t *testing.T) {
+	calls := 0
+	next := func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		calls++
+		status := http.StatusServiceUnavailable
+		if calls == 2 {
+			status = http.StatusOK
+		}
+		return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+	}
+
+	mw := Retry(client.RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+	req, err := http.NewRequest(http.MethodGet, "http://example.invalid", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	resp, err := mw(next)(context.Background(), req)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("StatusCode = %d, want 200", resp.StatusCode)
+	}
+	if calls != 2 {
+		t.Fatalf("calls = %d, want 2", calls)
+	}
+}
+
+func TestRetryNeverRetriesPOST(t *testing.T) {
+	calls := 0
+	next := func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+	}
+
+	mw := Retry(client.RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+	req, err := http.NewRequest(http.MethodPost, "http://example.invalid", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	resp, err := mw(next)(context.Background(), req)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("StatusCode = %d, want 503", resp.StatusCode)
+	}
+	if calls != 1 {
+		t.Fatalf("calls = %d, want 1 (POST must not be retried)", calls)
+	}
+}
+
+func TestRetryRewindsBodyOnRetry(t *testing.T) {
+	var seenBodies []string
+	next := func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		body := make([]byte, 0)
+		if req.Body != nil {
+			buf := make([]byte, 64)
+			n, _ := req.Body.Read(buf)
+			body = buf[:n]
+		}
+		seenBodies = append(seenBodies, string(body))
+
+		status := http.StatusServiceUnavailable
+		if len(seenBodies) == 2 {
+			status = http.StatusOK
+		}
+		return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+	}
+
+	mw := Retry(client.RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+	req, err := http.NewRequest(http.MethodPut, "http://example.invalid", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	resp, err := mw(next)(context.Background(), req)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("StatusCode = %d, want 200", resp.StatusCode)
+	}
+	if len(seenBodies) != 2 || seenBodies[0] != "payload" || seenBodies[1] != "payload" {
+		t.Fatalf("seenBodies = %v, want [\"payload\" \"payload\"]", seenBodies)
+	}
+}
+
+func TestRetryDoesNotRetryPUTWithNonSeekableBody(t *testing.T) {
+	calls := 0
+	next := func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+	}
+
+	mw := Retry(client.RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+	// opaqueReader is a plain io.Reader, not one of the stdlib types
+	// (*bytes.Reader, *bytes.Buffer, *strings.Reader) that NewRequest
+	// auto-populates GetBody for, so the request body is non-seekable.
+	req, err := http.NewRequest(http.MethodPut, "http://example.invalid", &opaqueReader{Reader: strings.NewReader("payload")})
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	resp, err := mw(next)(context.Background(), req)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("StatusCode = %d, want 503", resp.StatusCode)
+	}
+	if calls != 1 {
+		t.Fatalf("calls = %d, want 1 (non-seekable body must not be retried)", calls)
+	}
+}
+
+// opaqueReader wraps an io.Reader without exposing any of the concrete
+// types NewRequest special-cases for GetBody.
+type opaqueReader struct{ *strings.Reader }